@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"io"
+	"sync"
+)
+
+// OverflowPolicy controls what an async writer does when its buffer
+// channel is full.
+type OverflowPolicy int
+
+const (
+	// PolicyBlock blocks the producer until a slot frees up, so no log
+	// record is ever lost.
+	PolicyBlock OverflowPolicy = iota
+	// PolicyDropOldest discards the oldest buffered record to make
+	// room for the new one, so producers are never slowed down by a
+	// slow writer.
+	PolicyDropOldest
+)
+
+// asyncEntry is either a formatted record to be written, or a flush
+// marker (sig set) used to know when every record queued before it has
+// been written out.
+type asyncEntry struct {
+	data []byte
+	sig  chan struct{}
+}
+
+// asyncWriter implements io.Writer by enqueuing each write onto a
+// buffered channel drained by a single background goroutine, so
+// producers never block on the underlying writer's I/O.
+type asyncWriter struct {
+	out     io.Writer
+	entries chan asyncEntry
+	policy  OverflowPolicy
+
+	// mu guards isClosed, which Write and Flush check before sending
+	// onto entries: closing entries and enqueueing onto it must never
+	// race, or a send can panic against a channel Close just closed.
+	mu       sync.Mutex
+	isClosed bool
+
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// newAsyncWriter starts the background goroutine and returns a writer
+// that enqueues onto a channel of the given capacity instead of
+// writing to out directly.
+func newAsyncWriter(out io.Writer, bufSize int, policy OverflowPolicy) *asyncWriter {
+	aw := &asyncWriter{
+		out:     out,
+		entries: make(chan asyncEntry, bufSize),
+		policy:  policy,
+	}
+	aw.wg.Add(1)
+	go aw.run()
+	return aw
+}
+
+func (aw *asyncWriter) run() {
+	defer aw.wg.Done()
+	for e := range aw.entries {
+		if e.sig != nil {
+			close(e.sig)
+			continue
+		}
+		aw.out.Write(e.data)
+	}
+}
+
+// Write copies and enqueues p; the background goroutine performs the
+// actual I/O. Under PolicyBlock it waits for a free slot when the
+// queue is full. Under PolicyDropOldest, the oldest queued record is
+// dropped to make room; a pending Flush marker is kept and queued
+// again instead of being dropped. A no-op after Close.
+func (aw *asyncWriter) Write(p []byte) (int, error) {
+	rec := append([]byte(nil), p...)
+	entry := asyncEntry{data: rec}
+
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if aw.isClosed {
+		return len(p), nil
+	}
+
+	if aw.policy == PolicyDropOldest {
+		select {
+		case aw.entries <- entry:
+		default:
+			// Losing a Flush marker would leave that Flush waiting
+			// forever, so markers are set aside and queued again.
+			var markers []asyncEntry
+			for dropped := false; !dropped; {
+				select {
+				case old := <-aw.entries:
+					if old.sig != nil {
+						markers = append(markers, old)
+						continue
+					}
+					dropped = true
+				default:
+					dropped = true
+				}
+			}
+			for _, m := range markers {
+				aw.entries <- m
+			}
+			select {
+			case aw.entries <- entry:
+			default:
+			}
+		}
+		return len(p), nil
+	}
+
+	aw.entries <- entry
+	return len(p), nil
+}
+
+// Flush blocks until every record queued before this call has been
+// written to the underlying writer. It is a no-op once Close has been
+// called.
+func (aw *asyncWriter) Flush() {
+	aw.mu.Lock()
+	if aw.isClosed {
+		aw.mu.Unlock()
+		return
+	}
+	done := make(chan struct{})
+	aw.entries <- asyncEntry{sig: done}
+	aw.mu.Unlock()
+	<-done
+}
+
+// Close stops accepting new records, waits for the background
+// goroutine to drain the queue, and closes the underlying writer if it
+// supports it.
+func (aw *asyncWriter) Close() error {
+	aw.once.Do(func() {
+		aw.mu.Lock()
+		aw.isClosed = true
+		close(aw.entries)
+		aw.mu.Unlock()
+	})
+	aw.wg.Wait()
+	if c, ok := aw.out.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
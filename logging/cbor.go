@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// encodeCBOR renders v as CBOR (RFC 8949). It supports the minimal
+// subset TransactionRecord needs: nil, bool, string, int, int64,
+// LogLevel, float64, time.Time (tagged per RFC 8949 section 3.4.1),
+// map[string]any and []any. Any other type, including the other
+// integer and float kinds, is an error.
+func encodeCBOR(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := cborEncode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// cborHead writes a CBOR major type/argument pair, choosing the
+// shortest encoding for n as RFC 8949 section 3 requires.
+func cborHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= 0xff:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= 0xffffffff:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+func cborEncodeInt(buf *bytes.Buffer, n int64) {
+	if n >= 0 {
+		cborHead(buf, 0, uint64(n))
+	} else {
+		cborHead(buf, 1, uint64(-(n + 1)))
+	}
+}
+
+func cborEncode(buf *bytes.Buffer, v any) error {
+	switch t := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if t {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case string:
+		cborHead(buf, 3, uint64(len(t)))
+		buf.WriteString(t)
+	case int:
+		cborEncodeInt(buf, int64(t))
+	case int64:
+		cborEncodeInt(buf, t)
+	case LogLevel:
+		cborEncodeInt(buf, int64(t))
+	case float64:
+		buf.WriteByte(0xfb) // major 7, 64-bit float
+		binary.Write(buf, binary.BigEndian, math.Float64bits(t))
+	case time.Time:
+		buf.WriteByte(0xc0) // tag 0: RFC 3339 date/time string
+		return cborEncode(buf, t.UTC().Format(time.RFC3339Nano))
+	case map[string]any:
+		cborHead(buf, 5, uint64(len(t)))
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := cborEncode(buf, k); err != nil {
+				return err
+			}
+			if err := cborEncode(buf, t[k]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		cborHead(buf, 4, uint64(len(t)))
+		for _, item := range t {
+			if err := cborEncode(buf, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("logging: cannot encode %T as CBOR", v)
+	}
+	return nil
+}
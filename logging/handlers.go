@@ -0,0 +1,25 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+)
+
+// handlerOptions builds the slog.HandlerOptions equivalent to the
+// given LogLevel, for use by the built-in handler constructors below.
+func handlerOptions(level LogLevel) *slog.HandlerOptions {
+	return &slog.HandlerOptions{Level: level.SlogLevel()}
+}
+
+// NewTextHandler returns a slog.Handler that writes human-readable,
+// logfmt-style records to w. It is the handler LoadLoggerWriter and
+// LoadLogger install by default.
+func NewTextHandler(w io.Writer, level LogLevel) slog.Handler {
+	return slog.NewTextHandler(w, handlerOptions(level))
+}
+
+// NewJSONHandler returns a slog.Handler that writes each record as a
+// single JSON object to w.
+func NewJSONHandler(w io.Writer, level LogLevel) slog.Handler {
+	return slog.NewJSONHandler(w, handlerOptions(level))
+}
@@ -5,18 +5,17 @@ file.
 package logging
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"sync"
+	"time"
 )
 
-// TODOs:
-//  - Add support for logging to RSYSLOG configurable by the wace config
-
 // LogLevel indicates the criticality of a message, either error,
 // warning or debug.
 type LogLevel int
@@ -61,13 +60,80 @@ func StringToLogLevel(textLevel string) (LogLevel, error) {
 	return -1, errors.New("invalid log level " + textLevel)
 }
 
+// SlogLevel translates a LogLevel to its log/slog equivalent, so a
+// LogLevel can be handed to any handler in the slog ecosystem.
+func (ll LogLevel) SlogLevel() slog.Level {
+	switch ll {
+	case ERROR:
+		return slog.LevelError
+	case WARN:
+		return slog.LevelWarn
+	case INFO:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// FromSlogLevel translates a slog.Level back to the closest internal
+// LogLevel, rounding down towards the less critical level (eg: a slog
+// level between LevelInfo and LevelWarn maps to INFO).
+func FromSlogLevel(l slog.Level) LogLevel {
+	switch {
+	case l >= slog.LevelError:
+		return ERROR
+	case l >= slog.LevelWarn:
+		return WARN
+	case l >= slog.LevelInfo:
+		return INFO
+	default:
+		return DEBUG
+	}
+}
+
 // The Logging struct holds the configured logged information.
 type Logging struct {
 	level LogLevel
 
-	transactionLevel   LogLevel
-	transactionBuffers map[string]*bytes.Buffer
-	transactionMutex   sync.RWMutex
+	// sinks holds the registered log destinations. A Logging obtained
+	// from Get() before any setup has none, so it falls back to the
+	// stdlib "log" package as before.
+	sinks      []namedSink
+	sinksMutex sync.RWMutex
+
+	// asyncWriter is non-nil when LoadLoggerAsync set up the logger,
+	// and backs Flush/Close.
+	asyncWriter *asyncWriter
+
+	// vmoduleMu guards vmoduleRules and vcache, used by SetVModule and
+	// V for per-module verbosity filtering.
+	vmoduleMu    sync.RWMutex
+	vmoduleRules []vmoduleRule
+	vcache       *sync.Map
+
+	// format selects how EndTransaction serializes a TransactionRecord.
+	format Format
+
+	transactionLevel LogLevel
+	transactions     map[string]*transactionState
+	transactionMutex sync.RWMutex
+
+	// limitMu guards the rate limiting and sampling state set up by
+	// SetRateLimit/SetSampling, including the per-transaction buckets
+	// lazily created from them.
+	limitMu       sync.Mutex
+	rateLimitCfgs map[LogLevel]rateLimitCfg
+	rateLimits    map[LogLevel]*tokenBucket
+	txRateLimits  map[txLimitKey]*tokenBucket
+	samplingCfgs  map[LogLevel]int
+	samplers      map[LogLevel]*sampler
+	txSamplers    map[txLimitKey]*sampler
+
+	droppedMu        sync.Mutex
+	dropped          map[LogLevel]int64
+	dropReporterOnce sync.Once
+	dropReporterStop sync.Once
+	dropReporterDone chan struct{}
 }
 
 var logInstance *Logging
@@ -78,100 +144,318 @@ func Get() *Logging {
 		logInstance = new(Logging)
 		logInstance.level = INFO
 		logInstance.transactionLevel = WARN
-		logInstance.transactionBuffers = make(map[string]*bytes.Buffer)
+		logInstance.transactions = make(map[string]*transactionState)
 	}
 	return logInstance
 }
 
-// LoadLoggerWriter sets up everything for the logging inside the given buffer
-func (l *Logging) LoadLoggerWriter(logBuffer io.Writer, logLevel LogLevel) error {
+// LoadLoggerHandler sets up the logging to go through the given
+// slog.Handler, registered as the "default" sink, allowing integration
+// with any handler in the slog ecosystem (eg: OpenTelemetry bridges,
+// log aggregator clients). opts can include WithFormat to select how
+// EndTransaction serializes a transaction's TransactionRecord.
+func (l *Logging) LoadLoggerHandler(h slog.Handler, logLevel LogLevel, opts ...Option) error {
 	l.level = logLevel
-	log.SetOutput(logBuffer)
-	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
-	log.Println()
-	log.Println("-----WACE started-----")
+	l.applyOptions(opts)
+	l.AddSink("default", newHandlerSink(h, logLevel))
+	_ = h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "-----WACE started-----", 0))
 	return nil
 }
 
+// LoadLoggerWriter sets up everything for the logging inside the given buffer
+func (l *Logging) LoadLoggerWriter(logBuffer io.Writer, logLevel LogLevel, opts ...Option) error {
+	return l.LoadLoggerHandler(NewTextHandler(logBuffer, logLevel), logLevel, opts...)
+}
+
 // LoadLogger loads the logging file and sets up everything for the
 // logging inside the log file
-func (l *Logging) LoadLogger(logPath string, logLevel LogLevel) error {
+func (l *Logging) LoadLogger(logPath string, logLevel LogLevel, opts ...Option) error {
 	fh, err := os.OpenFile(logPath, os.O_APPEND|os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
 		return err
 	}
-	return l.LoadLoggerWriter(fh, logLevel)
+	return l.LoadLoggerWriter(fh, logLevel, opts...)
+}
+
+// LoadLoggerAsync loads the logging file as LoadLogger does, but routes
+// writes through a buffered channel drained by a single background
+// goroutine, so Println/Printf/TPrintln/TPrintf never block on file
+// I/O. bufSize sets the channel capacity, and policy controls what
+// happens when it fills up. Call Close to stop the background
+// goroutine and release the file.
+func (l *Logging) LoadLoggerAsync(logPath string, logLevel LogLevel, bufSize int, policy OverflowPolicy, opts ...Option) error {
+	fh, err := os.OpenFile(logPath, os.O_APPEND|os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	aw := newAsyncWriter(fh, bufSize, policy)
+	l.asyncWriter = aw
+	return l.LoadLoggerWriter(aw, logLevel, opts...)
+}
+
+// applyOptions runs every opt against l, in order.
+func (l *Logging) applyOptions(opts []Option) {
+	for _, opt := range opts {
+		opt(l)
+	}
+}
+
+// Flush blocks until every log record queued so far has been written
+// out. It is a no-op unless the logger was set up with
+// LoadLoggerAsync.
+func (l *Logging) Flush() {
+	if l.asyncWriter != nil {
+		l.asyncWriter.Flush()
+	}
+}
+
+// Close stops the drop reporter goroutine started by
+// SetRateLimit/SetSampling, if any, then flushes and stops the
+// background writer goroutine, if any, and closes the underlying log
+// file. The writer part is a no-op unless the logger was set up with
+// LoadLoggerAsync.
+func (l *Logging) Close() error {
+	l.dropReporterStop.Do(func() {
+		if l.dropReporterDone != nil {
+			close(l.dropReporterDone)
+		}
+	})
+	if l.asyncWriter != nil {
+		return l.asyncWriter.Close()
+	}
+	return nil
+}
+
+// sinkSnapshot returns the currently registered sinks under a read
+// lock, so callers can fan a message out without holding the lock for
+// the duration of each sink's I/O.
+func (l *Logging) sinkSnapshot() []namedSink {
+	l.sinksMutex.RLock()
+	defer l.sinksMutex.RUnlock()
+	return l.sinks
+}
+
+// log writes msg at the given level to every registered sink, falling
+// back to the stdlib "log" package if none has been configured yet.
+func (l *Logging) log(level LogLevel, msg string) {
+	sinks := l.sinkSnapshot()
+	if len(sinks) == 0 {
+		if level <= l.level {
+			log.Println(msg)
+		}
+		return
+	}
+	for _, s := range sinks {
+		s.sink.Write(level, msg)
+	}
 }
 
 // Println writes a message to the log if the given level is lower
-// than the configured max level.
+// than the configured max level, and isn't suppressed by
+// SetRateLimit/SetSampling.
 func (l *Logging) Println(level LogLevel, msg string) {
-	if level <= l.level {
-		log.Println(msg)
+	if !l.allowLevel(level) {
+		return
 	}
+	l.log(level, msg)
 }
 
 // Printf writes a message to the log if the given level is lower than
-// the configured max level. Arguments are handled as in fmt.Printf.
+// the configured max level, and isn't suppressed by
+// SetRateLimit/SetSampling. Arguments are handled as in fmt.Printf.
 func (l *Logging) Printf(level LogLevel, format string, v ...interface{}) {
-	if level <= l.level {
-		log.Printf(format, v...)
+	if !l.allowLevel(level) {
+		return
 	}
+	l.log(level, fmt.Sprintf(format, v...))
 }
 
-// StartTransaction creates a new buffer to log transaction
-// information to eventually send to the WAF.
-func (l *Logging) StartTransaction(transactionID string) {
+// logKV writes msg at the given level together with the given
+// key-value attributes to every registered sink that can preserve
+// structured attributes, falling back to flattening them into the
+// message text for sinks that can't, or to the stdlib "log" package if
+// no sink has been configured yet.
+func (l *Logging) logKV(level LogLevel, msg string, kv ...any) {
+	sinks := l.sinkSnapshot()
+	if len(sinks) == 0 {
+		if level <= l.level {
+			log.Println(append([]any{msg}, kv...)...)
+		}
+		return
+	}
+	for _, s := range sinks {
+		if ks, ok := s.sink.(kvSink); ok {
+			ks.WriteKV(level, msg, kv)
+		} else {
+			s.sink.Write(level, formatKV(msg, kv))
+		}
+	}
+}
+
+// formatKV appends alternating key/value pairs to msg as space
+// separated "key=value" fields, for sinks that cannot preserve
+// structured attributes.
+func formatKV(msg string, kv []any) string {
+	for i := 0; i+1 < len(kv); i += 2 {
+		msg = fmt.Sprintf("%s %v=%v", msg, kv[i], kv[i+1])
+	}
+	return msg
+}
+
+// ErrorKV writes a structured ERROR-level message with the given
+// key-value attributes.
+func (l *Logging) ErrorKV(msg string, kv ...any) { l.logKV(ERROR, msg, kv...) }
+
+// WarnKV writes a structured WARN-level message with the given
+// key-value attributes.
+func (l *Logging) WarnKV(msg string, kv ...any) { l.logKV(WARN, msg, kv...) }
+
+// InfoKV writes a structured INFO-level message with the given
+// key-value attributes.
+func (l *Logging) InfoKV(msg string, kv ...any) { l.logKV(INFO, msg, kv...) }
+
+// DebugKV writes a structured DEBUG-level message with the given
+// key-value attributes.
+func (l *Logging) DebugKV(msg string, kv ...any) { l.logKV(DEBUG, msg, kv...) }
+
+// TransactionLogger scopes log calls to a single transaction. It is
+// returned by StartTransaction and attaches the transaction ID as a
+// structured slog attribute instead of string-concatenating it into
+// the message.
+type TransactionLogger struct {
+	l             *Logging
+	transactionID string
+}
+
+// Println writes a level message to the log and the transaction
+// buffer, as TPrintln does for the transaction this logger was scoped
+// to.
+func (tl *TransactionLogger) Println(level LogLevel, msg string) {
+	tl.l.tlog(level, tl.transactionID, msg, nil)
+}
+
+// Printf writes a level message to the log and the transaction
+// buffer, as TPrintf does for the transaction this logger was scoped
+// to. Arguments are handled as in fmt.Printf.
+func (tl *TransactionLogger) Printf(level LogLevel, format string, v ...interface{}) {
+	tl.l.tlog(level, tl.transactionID, fmt.Sprintf(format, v...), nil)
+}
+
+// StartTransaction creates a new structured record to accumulate
+// transaction information to eventually send to the WAF, and returns a
+// TransactionLogger scoped to it.
+func (l *Logging) StartTransaction(transactionID string) *TransactionLogger {
 	l.transactionMutex.Lock()
-	if _, exists := l.transactionBuffers[transactionID]; !exists {
-		l.transactionBuffers[transactionID] = bytes.NewBufferString("")
+	if _, exists := l.transactions[transactionID]; !exists {
+		l.transactions[transactionID] = &transactionState{
+			record: TransactionRecord{TransactionID: transactionID, StartTime: time.Now()},
+		}
 	}
 	l.transactionMutex.Unlock()
+	return &TransactionLogger{l: l, transactionID: transactionID}
 }
 
-// TPrintln writes a level message to the log and transaction buffer.
-// It only writes to the log if the level is lower than the configured
-// max level. It only writes ERROR and WARN messages to the
-// transaction buffer.
-func (l *Logging) TPrintln(level LogLevel, transactionID, msg string) {
-	l.Println(level, "| "+transactionID+" | "+msg)
-
-	if level <= l.transactionLevel {
-		l.transactionMutex.RLock()
-		buff, exists := l.transactionBuffers[transactionID]
-		l.transactionMutex.RUnlock()
-		if exists {
-			buff.WriteString(msg)
-		} else {
-			l.Printf(WARN, "Cannot find transaction %s logging buffer", transactionID)
+// TLog records a structured event for transactionID with arbitrary
+// fields attached, and writes it to the log as TPrintln does. Use this
+// instead of TPrintln/TPrintf when a downstream WAF component needs to
+// parse specific fields out of a transaction's events rather than
+// grepping free text.
+func (l *Logging) TLog(level LogLevel, transactionID, event string, fields map[string]any) {
+	l.tlog(level, transactionID, event, fields)
+}
+
+// tlog writes msg to every registered sink, attaching the transaction
+// ID (and any fields) as structured attributes where a sink can
+// preserve them, then records msg as an event on the transaction's
+// TransactionRecord. Only ERROR and WARN messages are appended to the
+// legacy buffer EndTransaction returns. Subject to SetRateLimit and
+// SetSampling, applied through a bucket scoped to transactionID.
+func (l *Logging) tlog(level LogLevel, transactionID, msg string, fields map[string]any) {
+	if !l.allowTransaction(level, transactionID) {
+		return
+	}
+
+	sinks := l.sinkSnapshot()
+	if len(sinks) == 0 {
+		if level <= l.level {
+			log.Println("| " + transactionID + " | " + msg)
+		}
+	} else {
+		kv := make([]any, 0, len(fields)+1)
+		kv = append(kv, slog.String("transaction_id", transactionID))
+		for k, v := range fields {
+			kv = append(kv, slog.Any(k, v))
+		}
+		for _, s := range sinks {
+			if ks, ok := s.sink.(kvSink); ok {
+				ks.WriteKV(level, msg, kv)
+			} else {
+				s.sink.Write(level, "| "+transactionID+" | "+msg)
+			}
 		}
 	}
-}
 
-// TPrintf writes a level message to the log and transaction buffer.
-// It only writes to the log if the level is lower than the configured
-// max level. It only writes ERROR and WARN messages to the
-// transaction buffer. Arguments are handled as in fmt.Printf.
-func (l *Logging) TPrintf(level LogLevel, transactionID, format string, v ...interface{}) {
-	l.Printf(level, "| "+transactionID+" | "+format, v...)
-
-	if level <= l.transactionLevel {
-		l.transactionMutex.RLock()
-		buff, exists := l.transactionBuffers[transactionID]
-		l.transactionMutex.RUnlock()
-		if exists {
-			buff.WriteString(fmt.Sprintf(format, v...))
-		} else {
-			l.Printf(WARN, "Cannot find transaction %s logging buffer", transactionID)
+	l.transactionMutex.Lock()
+	state, exists := l.transactions[transactionID]
+	if exists {
+		state.record.Events = append(state.record.Events, TransactionEvent{
+			Time:    time.Now(),
+			Level:   level,
+			Message: msg,
+			Fields:  fields,
+		})
+		if level <= l.transactionLevel {
+			state.legacy.WriteString(msg)
 		}
 	}
+	l.transactionMutex.Unlock()
+
+	if !exists && level <= l.transactionLevel {
+		l.Printf(WARN, "Cannot find transaction %s logging buffer", transactionID)
+	}
 }
 
-// EndTransaction returns the logging buffer for the transaction
-func (l *Logging) EndTransaction(transactionID string) []byte {
+// TPrintln writes a level message to the log and records it as an
+// event on the transaction. It only writes to the log if the level is
+// lower than the configured max level. It only appends ERROR and WARN
+// messages to the legacy buffer EndTransaction returns.
+func (l *Logging) TPrintln(level LogLevel, transactionID, msg string) {
+	l.tlog(level, transactionID, msg, nil)
+}
+
+// TPrintf writes a level message to the log and records it as an event
+// on the transaction. It only writes to the log if the level is lower
+// than the configured max level. It only appends ERROR and WARN
+// messages to the legacy buffer EndTransaction returns. Arguments are
+// handled as in fmt.Printf.
+func (l *Logging) TPrintf(level LogLevel, transactionID, format string, v ...interface{}) {
+	l.tlog(level, transactionID, fmt.Sprintf(format, v...), nil)
+}
+
+// EndTransaction returns the legacy ERROR/WARN buffer for backward
+// compatibility, the full TransactionRecord, and that record marshaled
+// per the Format given to LoadLogger* via WithFormat (FormatJSON by
+// default). An unknown or already-ended transactionID is not an
+// error: it logs a warning and, instead of panicking, returns a nil
+// buffer, a record holding only the transaction ID, and nil marshaled
+// bytes.
+func (l *Logging) EndTransaction(transactionID string) ([]byte, TransactionRecord, []byte) {
+	l.Flush()
 	l.transactionMutex.Lock()
-	res := l.transactionBuffers[transactionID].Bytes()
-	delete(l.transactionBuffers, transactionID)
+	state, exists := l.transactions[transactionID]
+	delete(l.transactions, transactionID)
 	l.transactionMutex.Unlock()
-	return res
+	l.clearTransactionLimits(transactionID)
+
+	if !exists {
+		l.Printf(WARN, "EndTransaction called for unknown transaction %s", transactionID)
+		return nil, TransactionRecord{TransactionID: transactionID}, nil
+	}
+
+	state.record.EndTime = time.Now()
+	marshaled, err := state.record.Marshal(l.format)
+	if err != nil {
+		l.Printf(WARN, "cannot marshal transaction %s record: %v", transactionID, err)
+	}
+	return state.legacy.Bytes(), state.record, marshaled
 }
@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"math/rand"
+	"net"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var msg1 = "Lorem ipsum dolor sit amet"
@@ -119,8 +124,34 @@ func TestTransactionLogger(t *testing.T) {
 	l.TPrintln(WARN, generateRandomID(), msg1)
 	l.TPrintf(ERROR, generateRandomID(), "%s", msg2)
 
-	logContents := l.EndTransaction(transactionID)
+	legacy, record, _ := l.EndTransaction(transactionID)
 
+	if !strings.Contains(string(legacy), msg1) {
+		t.Errorf("legacy buffer is \"%s\", should include \"%s\"", legacy, msg1)
+	}
+	if !strings.Contains(string(legacy), msg2) {
+		t.Errorf("legacy buffer is \"%s\", should include \"%s\"", legacy, msg2)
+	}
+
+	if strings.Contains(string(legacy), msgNot) {
+		t.Errorf("legacy buffer contains \"%s\", but shouldn't", msgNot)
+	}
+
+	if record.TransactionID != transactionID {
+		t.Errorf("record transaction ID is %q, expected %q", record.TransactionID, transactionID)
+	}
+	if len(record.Events) != 3 {
+		t.Errorf("record has %d events, expected 3: %+v", len(record.Events), record.Events)
+	}
+	if record.EndTime.Before(record.StartTime) {
+		t.Errorf("record end time %v is before start time %v", record.EndTime, record.StartTime)
+	}
+
+	// Test standard log
+	logContents, err := ioutil.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Errorf("cannot read log file: %v", err)
+	}
 	if !strings.Contains(string(logContents), msg1) {
 		t.Errorf("log output is \"%s\", should include \"%s\"", logContents, msg1)
 	}
@@ -128,12 +159,31 @@ func TestTransactionLogger(t *testing.T) {
 		t.Errorf("log output is \"%s\", should include \"%s\"", logContents, msg2)
 	}
 
-	if strings.Contains(string(logContents), msgNot) {
-		t.Errorf("log output contains \"%s\", but shouldn't", msgNot)
+	if !strings.Contains(string(logContents), msgNot) {
+		t.Errorf("log output is \"%s\", should include \"%s\"", logContents, msgNot)
 	}
 
-	// Test standard log
-	logContents, err = ioutil.ReadFile(tmpFile.Name())
+}
+
+func TestLoadLoggerAsync(t *testing.T) {
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "logging_test-")
+	if err != nil {
+		t.Errorf("cannot create temporary file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	l := Get()
+	err = l.LoadLoggerAsync(tmpFile.Name(), WARN, 16, PolicyBlock)
+	if err != nil {
+		t.Errorf("LoadLoggerAsync(%s) raised error: %v", tmpFile.Name(), err)
+	}
+	defer l.Close()
+
+	l.Printf(ERROR, "%s", msg1)
+	l.Println(WARN, msg2)
+	l.Flush()
+
+	logContents, err := ioutil.ReadFile(tmpFile.Name())
 	if err != nil {
 		t.Errorf("cannot read log file: %v", err)
 	}
@@ -143,9 +193,375 @@ func TestTransactionLogger(t *testing.T) {
 	if !strings.Contains(string(logContents), msg2) {
 		t.Errorf("log output is \"%s\", should include \"%s\"", logContents, msg2)
 	}
+}
 
-	if !strings.Contains(string(logContents), msgNot) {
-		t.Errorf("log output is \"%s\", should include \"%s\"", logContents, msgNot)
+func TestAsyncWriterConcurrentClose(t *testing.T) {
+	aw := newAsyncWriter(ioutil.Discard, 4, PolicyBlock)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			aw.Write([]byte(msg1))
+		}()
 	}
 
+	// this should not panic, even racing the writers above:
+	aw.Close()
+	wg.Wait()
+}
+
+func TestSinksConcurrentAdd(t *testing.T) {
+	l := new(Logging)
+	l.level = DEBUG
+	l.transactions = make(map[string]*transactionState)
+	l.AddSink("ring", NewRingBufferSink(16, DEBUG))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			l.Println(DEBUG, msg1)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			l.AddSink("ring", NewRingBufferSink(16, DEBUG))
+		}
+	}()
+	// this should not race (run with -race), even if AddSink keeps
+	// replacing an already-registered name while Println iterates:
+	wg.Wait()
+}
+
+func TestMultiSink(t *testing.T) {
+	l := new(Logging)
+	l.level = DEBUG
+	l.transactionLevel = WARN
+	l.transactions = make(map[string]*transactionState)
+
+	debugSink := NewRingBufferSink(16, DEBUG)
+	warnSink := NewRingBufferSink(16, WARN)
+	l.AddSink("debug", debugSink)
+	l.AddSink("warn", warnSink)
+
+	l.Println(INFO, msg1)
+	l.Println(DEBUG, msg2)
+
+	if entries := debugSink.Entries(); len(entries) != 2 {
+		t.Errorf("debug sink has %d entries, expected 2: %v", len(entries), entries)
+	}
+	if entries := warnSink.Entries(); len(entries) != 0 {
+		t.Errorf("warn sink has %d entries, expected 0: %v", len(entries), entries)
+	}
+
+	l.RemoveSink("debug")
+	l.Println(INFO, msgNot)
+
+	if entries := debugSink.Entries(); len(entries) != 2 {
+		t.Errorf("debug sink has %d entries after removal, expected 2: %v", len(entries), entries)
+	}
+}
+
+func TestSyslogSinkUnix(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "test.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("cannot listen on %s: %v", sockPath, err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 4096)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		received <- string(buf[:n])
+	}()
+
+	sink, err := NewSyslogSink(SyslogConfig{Transport: SyslogUnix, Address: sockPath, Facility: FacilityLocal0}, WARN)
+	if err != nil {
+		t.Fatalf("NewSyslogSink raised error: %v", err)
+	}
+	sink.WriteKV(ERROR, msg1, []any{slog.String("transaction_id", "tx-1")})
+
+	select {
+	case rec := <-received:
+		if !strings.Contains(rec, msg1) {
+			t.Errorf("syslog record is %q, should include %q", rec, msg1)
+		}
+		if !strings.Contains(rec, `transactionID="tx-1"`) {
+			t.Errorf("syslog record is %q, should include transaction ID structured data", rec)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("timed out waiting for syslog record")
+	}
+}
+
+func TestTLogAndFormats(t *testing.T) {
+	l := new(Logging)
+	l.level = DEBUG
+	l.transactionLevel = WARN
+	l.transactions = make(map[string]*transactionState)
+
+	transactionID := generateRandomID()
+	l.StartTransaction(transactionID)
+	l.TLog(WARN, transactionID, "rule_matched", map[string]any{"rule_id": 942100})
+
+	_, record, _ := l.EndTransaction(transactionID)
+	if len(record.Events) != 1 {
+		t.Fatalf("record has %d events, expected 1: %+v", len(record.Events), record.Events)
+	}
+	if record.Events[0].Fields["rule_id"] != 942100 {
+		t.Errorf("event fields are %+v, expected rule_id 942100", record.Events[0].Fields)
+	}
+
+	for _, format := range []Format{FormatJSON, FormatLogfmt, FormatCBOR} {
+		out, err := record.Marshal(format)
+		if err != nil {
+			t.Errorf("Marshal(%d) raised error: %v", format, err)
+		}
+		if len(out) == 0 {
+			t.Errorf("Marshal(%d) returned no output", format)
+		}
+	}
+}
+
+func TestEndTransactionUnknownID(t *testing.T) {
+	l := new(Logging)
+	l.transactions = make(map[string]*transactionState)
+
+	// this should not panic:
+	legacy, record, _ := l.EndTransaction(generateRandomID())
+
+	if legacy != nil {
+		t.Errorf("legacy buffer is %v, expected nil", legacy)
+	}
+	if len(record.Events) != 0 {
+		t.Errorf("record has %d events, expected 0: %+v", len(record.Events), record.Events)
+	}
+}
+
+func TestSetRateLimit(t *testing.T) {
+	l := new(Logging)
+	l.transactions = make(map[string]*transactionState)
+	sink := NewRingBufferSink(16, DEBUG)
+	l.AddSink("ring", sink)
+
+	l.SetRateLimit(WARN, 1, 2)
+	for i := 0; i < 5; i++ {
+		l.Println(WARN, msg1)
+	}
+
+	if entries := sink.Entries(); len(entries) != 2 {
+		t.Errorf("sink has %d entries, expected 2 after rate limiting: %v", len(entries), entries)
+	}
+}
+
+func TestSetSampling(t *testing.T) {
+	l := new(Logging)
+	l.transactions = make(map[string]*transactionState)
+	sink := NewRingBufferSink(16, DEBUG)
+	l.AddSink("ring", sink)
+
+	l.SetSampling(INFO, 3)
+	for i := 0; i < 6; i++ {
+		l.Println(INFO, msg1)
+	}
+
+	if entries := sink.Entries(); len(entries) != 2 {
+		t.Errorf("sink has %d entries, expected 2 after 1-of-3 sampling: %v", len(entries), entries)
+	}
+}
+
+func TestRateLimitPerTransaction(t *testing.T) {
+	l := new(Logging)
+	l.transactions = make(map[string]*transactionState)
+	sink := NewRingBufferSink(16, DEBUG)
+	l.AddSink("ring", sink)
+
+	l.SetRateLimit(ERROR, 1, 1)
+
+	txA := generateRandomID()
+	txB := generateRandomID()
+	l.StartTransaction(txA)
+	l.StartTransaction(txB)
+
+	for i := 0; i < 3; i++ {
+		l.TPrintln(ERROR, txA, msg1)
+	}
+	l.TPrintln(ERROR, txB, msg2)
+
+	_, recordA, _ := l.EndTransaction(txA)
+	_, recordB, _ := l.EndTransaction(txB)
+
+	if len(recordA.Events) != 1 {
+		t.Errorf("transaction A has %d events, expected 1: %+v", len(recordA.Events), recordA.Events)
+	}
+	if len(recordB.Events) != 1 {
+		t.Errorf("transaction B has %d events, expected 1: %+v", len(recordB.Events), recordB.Events)
+	}
+}
+
+func TestSetRateLimitAndSamplingIgnoreNonPositive(t *testing.T) {
+	l := new(Logging)
+	l.transactions = make(map[string]*transactionState)
+	sink := NewRingBufferSink(16, DEBUG)
+	l.AddSink("ring", sink)
+
+	// these should not panic, and should leave the level unthrottled:
+	l.SetRateLimit(WARN, 0, 2)
+	l.SetRateLimit(WARN, 2, 0)
+	l.SetSampling(WARN, 0)
+
+	for i := 0; i < 5; i++ {
+		l.Println(WARN, msg1)
+	}
+
+	count := 0
+	for _, e := range sink.Entries() {
+		if e == msg1 {
+			count++
+		}
+	}
+	if count != 5 {
+		t.Errorf("got %d copies of msg1, expected 5: non-positive SetRateLimit/SetSampling should be a no-op, entries: %v", count, sink.Entries())
+	}
+}
+
+func TestEndTransactionMarshalsConfiguredFormat(t *testing.T) {
+	l := new(Logging)
+	l.transactions = make(map[string]*transactionState)
+	l.applyOptions([]Option{WithFormat(FormatCBOR)})
+
+	transactionID := generateRandomID()
+	l.StartTransaction(transactionID)
+	l.TLog(WARN, transactionID, "rule_matched", map[string]any{"rule_id": 942100})
+
+	_, record, marshaled := l.EndTransaction(transactionID)
+
+	want, err := record.Marshal(FormatCBOR)
+	if err != nil {
+		t.Fatalf("Marshal(FormatCBOR) raised error: %v", err)
+	}
+	if !bytes.Equal(marshaled, want) {
+		t.Errorf("EndTransaction marshaled bytes are %v, expected the configured FormatCBOR encoding %v", marshaled, want)
+	}
+}
+
+func TestEndTransactionClearsLimits(t *testing.T) {
+	l := new(Logging)
+	l.transactions = make(map[string]*transactionState)
+	sink := NewRingBufferSink(16, DEBUG)
+	l.AddSink("ring", sink)
+
+	l.SetRateLimit(ERROR, 1, 1)
+	l.SetSampling(ERROR, 2)
+
+	transactionID := generateRandomID()
+	l.StartTransaction(transactionID)
+	l.TPrintln(ERROR, transactionID, msg1)
+	l.EndTransaction(transactionID)
+
+	l.limitMu.Lock()
+	rateLimits, samplers := len(l.txRateLimits), len(l.txSamplers)
+	l.limitMu.Unlock()
+
+	if rateLimits != 0 {
+		t.Errorf("txRateLimits has %d entries after EndTransaction, expected 0", rateLimits)
+	}
+	if samplers != 0 {
+		t.Errorf("txSamplers has %d entries after EndTransaction, expected 0", samplers)
+	}
+}
+
+func TestVModule(t *testing.T) {
+	l := new(Logging)
+	l.level = WARN
+	l.transactions = make(map[string]*transactionState)
+	sink := NewRingBufferSink(16, DEBUG)
+	l.AddSink("ring", sink)
+
+	// With no vmodule rules, V(DEBUG) falls back to the overall level
+	// (WARN), so it's disabled.
+	l.V(DEBUG).Println(msgNot)
+	if entries := sink.Entries(); len(entries) != 0 {
+		t.Errorf("expected V(DEBUG) to be disabled by default, got entries: %v", entries)
+	}
+
+	if err := l.SetVModule("logging_test=3"); err != nil {
+		t.Fatalf("SetVModule raised error: %v", err)
+	}
+
+	l.V(DEBUG).Println(msg1)
+	if entries := sink.Entries(); len(entries) != 1 || entries[0] != msg1 {
+		t.Errorf("expected V(DEBUG) to be enabled for this file, got entries: %v", entries)
+	}
+}
+
+func TestVModuleFallsBackOutsideConfiguredModules(t *testing.T) {
+	l := new(Logging)
+	l.level = WARN
+	l.transactions = make(map[string]*transactionState)
+	sink := NewRingBufferSink(16, DEBUG)
+	l.AddSink("ring", sink)
+
+	// A vmodule rule for an unrelated file/package should not disable
+	// V() calls from this file that don't match it: they should still
+	// fall back to the overall level, same as with no rules at all.
+	if err := l.SetVModule("nonexistent_module=3"); err != nil {
+		t.Fatalf("SetVModule raised error: %v", err)
+	}
+
+	l.V(ERROR).Println(msg1)
+	if entries := sink.Entries(); len(entries) != 1 || entries[0] != msg1 {
+		t.Errorf("expected V(ERROR) to fall back to the overall level outside configured modules, got entries: %v", entries)
+	}
+}
+
+func TestSetVModuleInvalid(t *testing.T) {
+	l := new(Logging)
+	if err := l.SetVModule("badentry"); err == nil {
+		t.Errorf("SetVModule with missing '=' did not return an error")
+	}
+	if err := l.SetVModule("pattern=notanumber"); err == nil {
+		t.Errorf("SetVModule with a non-numeric level did not return an error")
+	}
+}
+
+func benchmarkLogging(b *testing.B, l *Logging) {
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Println(WARN, msg1)
+	}
+	l.Flush()
+}
+
+func BenchmarkSyncLogging(b *testing.B) {
+	l := new(Logging)
+	l.transactions = make(map[string]*transactionState)
+	if err := l.LoadLoggerWriter(ioutil.Discard, WARN); err != nil {
+		b.Fatalf("LoadLoggerWriter raised error: %v", err)
+	}
+	benchmarkLogging(b, l)
+}
+
+func BenchmarkAsyncLogging(b *testing.B) {
+	l := new(Logging)
+	l.transactions = make(map[string]*transactionState)
+	if err := l.LoadLoggerAsync(os.DevNull, WARN, 1024, PolicyBlock); err != nil {
+		b.Fatalf("LoadLoggerAsync raised error: %v", err)
+	}
+	defer l.Close()
+	benchmarkLogging(b, l)
 }
@@ -0,0 +1,258 @@
+package logging
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// dropReportInterval is how often accumulated rate-limit/sampling drop
+// counts are flushed as a synthetic log line.
+const dropReportInterval = 10 * time.Second
+
+// rateLimitCfg is the (perSecond, burst) pair SetRateLimit configures
+// per level, kept around so a per-transaction bucket can be created
+// lazily with the same parameters the first time that level is used
+// on a new transaction ID.
+type rateLimitCfg struct {
+	perSecond int
+	burst     int
+}
+
+// txLimitKey scopes a per-transaction token bucket or sampler to a
+// single (transaction ID, level) pair.
+type txLimitKey struct {
+	transactionID string
+	level         LogLevel
+}
+
+// tokenBucket is a simple token-bucket rate limiter: up to burst
+// tokens are held, replenished at perSecond tokens/second, and Allow
+// reports whether a token was available to spend.
+type tokenBucket struct {
+	mu         sync.Mutex
+	perSecond  float64
+	burst      float64
+	tokens     float64
+	lastRefill time.Time
+}
+
+func newTokenBucket(perSecond, burst int) *tokenBucket {
+	return &tokenBucket{
+		perSecond:  float64(perSecond),
+		burst:      float64(burst),
+		tokens:     float64(burst),
+		lastRefill: time.Now(),
+	}
+}
+
+// Allow reports whether a token is available, spending one if so.
+func (b *tokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.lastRefill).Seconds() * b.perSecond
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.lastRefill = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sampler lets 1 in every n calls through, starting with the first.
+type sampler struct {
+	n       int64
+	counter int64
+}
+
+func newSampler(n int) *sampler {
+	return &sampler{n: int64(n)}
+}
+
+// Allow reports whether this call is the 1-of-n that should pass.
+func (s *sampler) Allow() bool {
+	c := atomic.AddInt64(&s.counter, 1)
+	return (c-1)%s.n == 0
+}
+
+// SetRateLimit token-bucket rate limits messages at level to perSecond
+// sustained, bursts up to burst. Applies to Println/Printf and, via a
+// bucket scoped to each transaction ID, the per-transaction variants.
+// perSecond and burst must both be positive; a non-positive value is
+// a no-op rather than installing a limiter that rejects or divides by
+// zero.
+func (l *Logging) SetRateLimit(level LogLevel, perSecond, burst int) {
+	if perSecond <= 0 || burst <= 0 {
+		l.Printf(WARN, "SetRateLimit(%s, %d, %d) ignored: perSecond and burst must both be positive", level, perSecond, burst)
+		return
+	}
+
+	l.limitMu.Lock()
+	if l.rateLimitCfgs == nil {
+		l.rateLimitCfgs = make(map[LogLevel]rateLimitCfg)
+	}
+	if l.rateLimits == nil {
+		l.rateLimits = make(map[LogLevel]*tokenBucket)
+	}
+	l.rateLimitCfgs[level] = rateLimitCfg{perSecond: perSecond, burst: burst}
+	l.rateLimits[level] = newTokenBucket(perSecond, burst)
+	l.limitMu.Unlock()
+	l.startDropReporter()
+}
+
+// SetSampling emits only 1 in every n messages at level, once sampling
+// is enabled, applying the same way SetRateLimit does to
+// Println/Printf and, per transaction ID, to the per-transaction
+// variants. n must be positive; a non-positive value is a no-op
+// rather than installing a sampler that divides by zero.
+func (l *Logging) SetSampling(level LogLevel, n int) {
+	if n <= 0 {
+		l.Printf(WARN, "SetSampling(%s, %d) ignored: n must be positive", level, n)
+		return
+	}
+
+	l.limitMu.Lock()
+	if l.samplingCfgs == nil {
+		l.samplingCfgs = make(map[LogLevel]int)
+	}
+	if l.samplers == nil {
+		l.samplers = make(map[LogLevel]*sampler)
+	}
+	l.samplingCfgs[level] = n
+	l.samplers[level] = newSampler(n)
+	l.limitMu.Unlock()
+	l.startDropReporter()
+}
+
+// allowLevel reports whether a non-transaction message at level should
+// be emitted, applying any rate limit and sampling configured for that
+// level.
+func (l *Logging) allowLevel(level LogLevel) bool {
+	l.limitMu.Lock()
+	bucket := l.rateLimits[level]
+	smp := l.samplers[level]
+	l.limitMu.Unlock()
+
+	if bucket != nil && !bucket.Allow() {
+		l.recordDrop(level)
+		return false
+	}
+	if smp != nil && !smp.Allow() {
+		l.recordDrop(level)
+		return false
+	}
+	return true
+}
+
+// allowTransaction reports whether a message at level for
+// transactionID should be emitted, using a bucket/sampler scoped to
+// that transaction ID so a single abusive transaction can't exhaust
+// the budget other transactions rely on.
+func (l *Logging) allowTransaction(level LogLevel, transactionID string) bool {
+	key := txLimitKey{transactionID: transactionID, level: level}
+
+	l.limitMu.Lock()
+	var bucket *tokenBucket
+	if cfg, ok := l.rateLimitCfgs[level]; ok {
+		bucket = l.txRateLimits[key]
+		if bucket == nil {
+			bucket = newTokenBucket(cfg.perSecond, cfg.burst)
+			if l.txRateLimits == nil {
+				l.txRateLimits = make(map[txLimitKey]*tokenBucket)
+			}
+			l.txRateLimits[key] = bucket
+		}
+	}
+	var smp *sampler
+	if n, ok := l.samplingCfgs[level]; ok {
+		smp = l.txSamplers[key]
+		if smp == nil {
+			smp = newSampler(n)
+			if l.txSamplers == nil {
+				l.txSamplers = make(map[txLimitKey]*sampler)
+			}
+			l.txSamplers[key] = smp
+		}
+	}
+	l.limitMu.Unlock()
+
+	if bucket != nil && !bucket.Allow() {
+		l.recordDrop(level)
+		return false
+	}
+	if smp != nil && !smp.Allow() {
+		l.recordDrop(level)
+		return false
+	}
+	return true
+}
+
+// clearTransactionLimits drops the per-transaction buckets and
+// samplers allowTransaction lazily created for transactionID, across
+// every level, so txRateLimits/txSamplers don't grow without bound.
+func (l *Logging) clearTransactionLimits(transactionID string) {
+	l.limitMu.Lock()
+	defer l.limitMu.Unlock()
+	for _, level := range []LogLevel{ERROR, WARN, INFO, DEBUG} {
+		key := txLimitKey{transactionID: transactionID, level: level}
+		delete(l.txRateLimits, key)
+		delete(l.txSamplers, key)
+	}
+}
+
+// recordDrop increments the suppressed-message counter for level, to
+// be flushed by the drop reporter goroutine.
+func (l *Logging) recordDrop(level LogLevel) {
+	l.droppedMu.Lock()
+	if l.dropped == nil {
+		l.dropped = make(map[LogLevel]int64)
+	}
+	l.dropped[level]++
+	l.droppedMu.Unlock()
+}
+
+// startDropReporter launches, once per Logging instance, a background
+// goroutine that periodically logs how many messages were suppressed
+// by rate limiting or sampling since the last report, so operators can
+// tell when suppression is active. It is stopped by Close.
+func (l *Logging) startDropReporter() {
+	l.dropReporterOnce.Do(func() {
+		l.dropReporterDone = make(chan struct{})
+		go l.reportDrops()
+	})
+}
+
+func (l *Logging) reportDrops() {
+	ticker := time.NewTicker(dropReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.flushDropCounters()
+		case <-l.dropReporterDone:
+			return
+		}
+	}
+}
+
+// flushDropCounters emits one synthetic WARN line per level with a
+// non-zero drop count accumulated since the last flush, then resets
+// the counters.
+func (l *Logging) flushDropCounters() {
+	l.droppedMu.Lock()
+	counts := l.dropped
+	l.dropped = nil
+	l.droppedMu.Unlock()
+
+	for level, n := range counts {
+		if n > 0 {
+			l.Printf(WARN, "suppressed %d %s message(s) in the last %s due to rate limiting/sampling", n, level, dropReportInterval)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"log/slog"
+)
+
+// LogSink is a single logging destination with its own level
+// threshold, independent of the Logging instance's overall level.
+// Logging fans every message out to all of its registered sinks.
+type LogSink interface {
+	// SetLevel changes the minimum level this sink writes.
+	SetLevel(level LogLevel)
+	// Write writes msg to the sink, if level is at or below the
+	// sink's configured threshold (ie: at least as critical).
+	Write(level LogLevel, msg string)
+}
+
+// kvSink is implemented by sinks that can preserve structured
+// key-value attributes instead of having them flattened into the
+// message text. The built-in slog-backed sinks implement it.
+type kvSink interface {
+	WriteKV(level LogLevel, msg string, kv []any)
+}
+
+// namedSink pairs a LogSink with the name it was registered under, so
+// it can be looked up again by RemoveSink.
+type namedSink struct {
+	name string
+	sink LogSink
+}
+
+// AddSink registers sink under name, fanning out future log calls to
+// it alongside any other registered sink. Registering under a name
+// that is already in use replaces the previous sink. It always builds
+// a fresh slice rather than mutating l.sinks in place, since
+// sinkSnapshot hands out the backing array to callers that iterate it
+// without holding sinksMutex.
+func (l *Logging) AddSink(name string, sink LogSink) {
+	l.sinksMutex.Lock()
+	defer l.sinksMutex.Unlock()
+	next := make([]namedSink, len(l.sinks))
+	copy(next, l.sinks)
+	for i, s := range next {
+		if s.name == name {
+			next[i].sink = sink
+			l.sinks = next
+			return
+		}
+	}
+	l.sinks = append(next, namedSink{name: name, sink: sink})
+}
+
+// RemoveSink unregisters the sink previously registered under name, if
+// any. Like AddSink, it builds a fresh slice rather than mutating
+// l.sinks in place.
+func (l *Logging) RemoveSink(name string) {
+	l.sinksMutex.Lock()
+	defer l.sinksMutex.Unlock()
+	for i, s := range l.sinks {
+		if s.name == name {
+			next := make([]namedSink, 0, len(l.sinks)-1)
+			next = append(next, l.sinks[:i]...)
+			next = append(next, l.sinks[i+1:]...)
+			l.sinks = next
+			return
+		}
+	}
+}
+
+// handlerSink is a LogSink backed by a slog.Handler, so it reuses the
+// same text/JSON formatting as LoadLoggerHandler and can preserve
+// structured attributes via kvSink.
+type handlerSink struct {
+	mu      sync.Mutex
+	level   LogLevel
+	handler slog.Handler
+}
+
+func newHandlerSink(h slog.Handler, level LogLevel) *handlerSink {
+	return &handlerSink{handler: h, level: level}
+}
+
+func (s *handlerSink) SetLevel(level LogLevel) {
+	s.mu.Lock()
+	s.level = level
+	s.mu.Unlock()
+}
+
+func (s *handlerSink) threshold() LogLevel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.level
+}
+
+func (s *handlerSink) Write(level LogLevel, msg string) {
+	s.WriteKV(level, msg, nil)
+}
+
+func (s *handlerSink) WriteKV(level LogLevel, msg string, kv []any) {
+	if level > s.threshold() {
+		return
+	}
+	r := slog.NewRecord(time.Now(), level.SlogLevel(), msg, 0)
+	r.Add(kv...)
+	_ = s.handler.Handle(context.Background(), r)
+}
+
+// NewWriterSink returns a LogSink that writes logfmt-style records to
+// w, filtering out anything above level.
+func NewWriterSink(w io.Writer, level LogLevel) LogSink {
+	return newHandlerSink(NewTextHandler(w, level), level)
+}
+
+// NewFileSink opens path and returns a LogSink that writes logfmt-style
+// records to it, filtering out anything above level.
+func NewFileSink(path string, level LogLevel) (LogSink, error) {
+	fh, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return newHandlerSink(NewTextHandler(fh, level), level), nil
+}
+
+// RingBufferSink is an in-memory LogSink that keeps only the last
+// capacity messages, for tests that want to assert on log output
+// without touching the filesystem.
+type RingBufferSink struct {
+	mu       sync.Mutex
+	level    LogLevel
+	capacity int
+	entries  []string
+}
+
+// NewRingBufferSink returns a RingBufferSink retaining up to capacity
+// messages at level or below.
+func NewRingBufferSink(capacity int, level LogLevel) *RingBufferSink {
+	return &RingBufferSink{capacity: capacity, level: level}
+}
+
+// SetLevel changes the minimum level this sink keeps.
+func (s *RingBufferSink) SetLevel(level LogLevel) {
+	s.mu.Lock()
+	s.level = level
+	s.mu.Unlock()
+}
+
+// Write appends msg to the ring buffer, evicting the oldest entry if
+// the buffer is at capacity.
+func (s *RingBufferSink) Write(level LogLevel, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if level > s.level {
+		return
+	}
+	s.entries = append(s.entries, msg)
+	if len(s.entries) > s.capacity {
+		s.entries = s.entries[len(s.entries)-s.capacity:]
+	}
+}
+
+// Entries returns a copy of the currently buffered messages, oldest
+// first.
+func (s *RingBufferSink) Entries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, len(s.entries))
+	copy(out, s.entries)
+	return out
+}
@@ -0,0 +1,281 @@
+package logging
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SyslogTransport selects how a SyslogSink reaches the syslog daemon.
+type SyslogTransport int
+
+const (
+	// SyslogUnix connects to the local syslog daemon over a Unix
+	// domain socket (eg: /dev/log).
+	SyslogUnix SyslogTransport = iota
+	// SyslogUDP sends each record as a UDP datagram.
+	SyslogUDP
+	// SyslogTCP sends records over a TCP stream, optionally wrapped
+	// in TLS.
+	SyslogTCP
+)
+
+// SyslogFraming selects the wire format used for each record.
+type SyslogFraming int
+
+const (
+	// RFC5424 frames each record per RFC 5424, including structured
+	// data such as the transaction ID.
+	RFC5424 SyslogFraming = iota
+	// RFC3164 frames each record per the older BSD syslog format.
+	RFC3164
+)
+
+// Facility is a syslog facility code, as defined in RFC 5424 section
+// 6.2.1.
+type Facility int
+
+// The subset of RFC 5424 facilities WACE is expected to log under.
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	_
+	_
+	_
+	_
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// severity maps a LogLevel to its syslog severity code, per RFC 5424
+// section 6.2.1. Only the four severities the rest of the package
+// uses (err/warning/info/debug) are represented.
+func (ll LogLevel) severity() int {
+	switch ll {
+	case ERROR:
+		return 3 // err
+	case WARN:
+		return 4 // warning
+	case INFO:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
+
+// SyslogConfig configures a SyslogSink.
+type SyslogConfig struct {
+	// Transport selects the connection type. Defaults to SyslogUnix.
+	Transport SyslogTransport
+	// Framing selects RFC 3164 or RFC 5424 framing. Defaults to
+	// RFC5424.
+	Framing SyslogFraming
+	// Address is a Unix socket path for SyslogUnix (defaults to
+	// /dev/log), or a "host:port" for SyslogUDP/SyslogTCP.
+	Address string
+	// TLSConfig, if non-nil, wraps a SyslogTCP connection in TLS.
+	TLSConfig *tls.Config
+	// Facility tags every record. The zero value is FacilityKern; no
+	// other default is applied.
+	Facility Facility
+	// AppName identifies this process in every record. Defaults to
+	// the running executable's base name.
+	AppName string
+	// Hostname identifies this host in every record. Defaults to
+	// os.Hostname().
+	Hostname string
+}
+
+const (
+	syslogMinBackoff = 100 * time.Millisecond
+	syslogMaxBackoff = 30 * time.Second
+)
+
+// SyslogSink is a LogSink that forwards records to a syslog daemon
+// over a Unix socket, UDP or TCP (optionally TLS), in RFC 3164 or RFC
+// 5424 framing, reconnecting with exponential backoff on failure.
+type SyslogSink struct {
+	cfg      SyslogConfig
+	hostname string
+	appName  string
+	pid      int
+
+	mu      sync.Mutex
+	level   LogLevel
+	conn    net.Conn
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// NewSyslogSink builds a SyslogSink from cfg and attempts an initial
+// connection.
+func NewSyslogSink(cfg SyslogConfig, level LogLevel) (*SyslogSink, error) {
+	hostname := cfg.Hostname
+	if hostname == "" {
+		if h, err := os.Hostname(); err == nil {
+			hostname = h
+		}
+	}
+	appName := cfg.AppName
+	if appName == "" && len(os.Args) > 0 {
+		appName = filepath.Base(os.Args[0])
+	}
+
+	s := &SyslogSink{
+		cfg:      cfg,
+		hostname: hostname,
+		appName:  appName,
+		pid:      os.Getpid(),
+		level:    level,
+		backoff:  syslogMinBackoff,
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SyslogSink) connect() error {
+	var conn net.Conn
+	var err error
+	switch s.cfg.Transport {
+	case SyslogUnix:
+		addr := s.cfg.Address
+		if addr == "" {
+			addr = "/dev/log"
+		}
+		conn, err = net.Dial("unix", addr)
+	case SyslogUDP:
+		conn, err = net.Dial("udp", s.cfg.Address)
+	case SyslogTCP:
+		if s.cfg.TLSConfig != nil {
+			conn, err = tls.Dial("tcp", s.cfg.Address, s.cfg.TLSConfig)
+		} else {
+			conn, err = net.Dial("tcp", s.cfg.Address)
+		}
+	default:
+		return fmt.Errorf("logging: unknown syslog transport %d", s.cfg.Transport)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+// reconnectLocked drops the current connection, if any, and retries
+// dialing no more often than the current backoff interval, doubling it
+// on repeated failure up to syslogMaxBackoff. The caller must hold
+// s.mu.
+func (s *SyslogSink) reconnectLocked() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	if time.Now().Before(s.retryAt) {
+		return
+	}
+	if err := s.connect(); err != nil {
+		s.retryAt = time.Now().Add(s.backoff)
+		s.backoff *= 2
+		if s.backoff > syslogMaxBackoff {
+			s.backoff = syslogMaxBackoff
+		}
+		return
+	}
+	s.backoff = syslogMinBackoff
+}
+
+// SetLevel changes the minimum level this sink forwards.
+func (s *SyslogSink) SetLevel(level LogLevel) {
+	s.mu.Lock()
+	s.level = level
+	s.mu.Unlock()
+}
+
+// Write forwards msg to the syslog daemon if level is at or below the
+// sink's configured threshold.
+func (s *SyslogSink) Write(level LogLevel, msg string) {
+	s.WriteKV(level, msg, nil)
+}
+
+// WriteKV forwards msg to the syslog daemon, surfacing a
+// "transaction_id" attribute as RFC 5424 structured data rather than
+// folding it into the message text.
+func (s *SyslogSink) WriteKV(level LogLevel, msg string, kv []any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if level > s.level {
+		return
+	}
+
+	rec := s.format(level, msg, kv)
+
+	if s.conn == nil {
+		s.reconnectLocked()
+	}
+	if s.conn == nil {
+		return // still down; drop rather than block the caller
+	}
+	if _, err := s.conn.Write(rec); err != nil {
+		s.reconnectLocked()
+	}
+}
+
+func (s *SyslogSink) format(level LogLevel, msg string, kv []any) []byte {
+	pri := int(s.cfg.Facility)*8 + level.severity()
+
+	if s.cfg.Framing == RFC3164 {
+		ts := time.Now().Format("Jan _2 15:04:05")
+		return []byte(fmt.Sprintf("<%d>%s %s %s[%d]: %s\n", pri, ts, s.hostname, s.appName, s.pid, msg))
+	}
+
+	ts := time.Now().Format(time.RFC3339)
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %d - %s %s\n", pri, ts, s.hostname, s.appName, s.pid, structuredData(kv), msg))
+}
+
+// structuredData renders a "transaction_id" attribute, if present in
+// kv, as RFC 5424 structured data under the "wace" SD-ID.
+func structuredData(kv []any) string {
+	for _, v := range kv {
+		if attr, ok := v.(slog.Attr); ok && attr.Key == "transaction_id" {
+			return fmt.Sprintf("[wace transactionID=%q]", attr.Value.String())
+		}
+	}
+	return "-"
+}
+
+// LoadLoggerSyslog sets up a SyslogSink from cfg and registers it
+// alongside any other configured sink (eg: the file sink from
+// LoadLogger). opts can include WithFormat to select how
+// EndTransaction serializes a transaction's TransactionRecord.
+func (l *Logging) LoadLoggerSyslog(cfg SyslogConfig, logLevel LogLevel, opts ...Option) error {
+	l.applyOptions(opts)
+	sink, err := NewSyslogSink(cfg, logLevel)
+	if err != nil {
+		return err
+	}
+	l.AddSink("syslog", sink)
+	return nil
+}
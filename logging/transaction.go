@@ -0,0 +1,149 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TransactionEvent is one structured log event recorded as part of a
+// transaction's lifecycle.
+type TransactionEvent struct {
+	Time    time.Time      `json:"time"`
+	Level   LogLevel       `json:"level"`
+	Message string         `json:"message"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+// MarshalJSON renders Level as its name (eg: "WARN") rather than its
+// underlying integer value.
+func (e TransactionEvent) MarshalJSON() ([]byte, error) {
+	type alias TransactionEvent
+	return json.Marshal(struct {
+		Level string `json:"level"`
+		alias
+	}{Level: e.Level.String(), alias: alias(e)})
+}
+
+// TransactionRecord is the structured summary of everything logged for
+// a single transaction: start and end time, the transaction ID, and
+// its ordered events. It is suitable for serializing to JSON, CBOR or
+// logfmt so a WAF or collector can parse it reliably, rather than
+// having to grep strings out of the legacy byte buffer.
+type TransactionRecord struct {
+	TransactionID string             `json:"transaction_id"`
+	StartTime     time.Time          `json:"start_time"`
+	EndTime       time.Time          `json:"end_time"`
+	Events        []TransactionEvent `json:"events"`
+}
+
+// transactionState is what StartTransaction allocates per transaction
+// ID: the structured record being accumulated, and the legacy
+// concatenated ERROR/WARN buffer kept for backward compatibility.
+type transactionState struct {
+	record TransactionRecord
+	legacy bytes.Buffer
+}
+
+// Format selects how TransactionRecord.Marshal (and so EndTransaction)
+// serializes a transaction record.
+type Format int
+
+const (
+	// FormatJSON serializes the record as a single JSON object.
+	FormatJSON Format = iota
+	// FormatLogfmt serializes the record as logfmt lines, one per
+	// event, preceded by a transaction header line.
+	FormatLogfmt
+	// FormatCBOR serializes the record as CBOR (RFC 8949).
+	FormatCBOR
+)
+
+// Option configures optional behavior on the LoadLogger* constructors.
+type Option func(*Logging)
+
+// WithFormat selects the serialization EndTransaction's
+// TransactionRecord uses. Defaults to FormatJSON.
+func WithFormat(f Format) Option {
+	return func(l *Logging) { l.format = f }
+}
+
+// Marshal serializes r using format.
+func (r TransactionRecord) Marshal(format Format) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.Marshal(r)
+	case FormatLogfmt:
+		return r.marshalLogfmt(), nil
+	case FormatCBOR:
+		return encodeCBOR(r.toMap())
+	default:
+		return nil, fmt.Errorf("logging: unknown format %d", format)
+	}
+}
+
+// toMap converts r into the map[string]any/[]any tree encodeCBOR
+// understands.
+func (r TransactionRecord) toMap() map[string]any {
+	events := make([]any, len(r.Events))
+	for i, e := range r.Events {
+		events[i] = e.toMap()
+	}
+	return map[string]any{
+		"transaction_id": r.TransactionID,
+		"start_time":     r.StartTime,
+		"end_time":       r.EndTime,
+		"events":         events,
+	}
+}
+
+func (e TransactionEvent) toMap() map[string]any {
+	m := map[string]any{
+		"time":    e.Time,
+		"level":   e.Level.String(),
+		"message": e.Message,
+	}
+	if len(e.Fields) > 0 {
+		fields := make(map[string]any, len(e.Fields))
+		for k, v := range e.Fields {
+			fields[k] = v
+		}
+		m["fields"] = fields
+	}
+	return m
+}
+
+// marshalLogfmt renders a transaction header line followed by one
+// logfmt line per event.
+func (r TransactionRecord) marshalLogfmt() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "transaction_id=%s start_time=%s end_time=%s\n",
+		logfmtQuote(r.TransactionID), r.StartTime.Format(time.RFC3339Nano), r.EndTime.Format(time.RFC3339Nano))
+
+	for _, e := range r.Events {
+		fmt.Fprintf(&b, "time=%s level=%s message=%s", e.Time.Format(time.RFC3339Nano), e.Level, logfmtQuote(e.Message))
+		keys := make([]string, 0, len(e.Fields))
+		for k := range e.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, " %s=%s", k, logfmtQuote(fmt.Sprint(e.Fields[k])))
+		}
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// logfmtQuote quotes s if it contains characters that would otherwise
+// break logfmt's "key=value" parsing.
+func logfmtQuote(s string) string {
+	if strings.ContainsAny(s, " \t\"=\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}